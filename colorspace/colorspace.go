@@ -0,0 +1,136 @@
+// Package colorspace converts between RGB and Y'CbCr using the matrices
+// and range conventions defined by the ITU-R BT.601/709/2020
+// recommendations, replacing the single hardcoded Rec.601-ish conversion
+// previously inlined in the encoder and decoder. Conversions are kept in
+// the float64 domain so callers that need to average several samples (as
+// the encoder does when downsampling chroma) can do so before rounding to
+// an 8-bit code value, rather than rounding each sample first and
+// compounding the error.
+package colorspace
+
+import "fmt"
+
+// Range selects whether code values occupy the full 0-255 range or the
+// "studio"/limited range conventionally used for broadcast video (luma
+// 16-235, chroma 16-240).
+type Range int
+
+const (
+	Limited Range = iota
+	Full
+)
+
+// Matrix is a 3x3 conversion matrix applied to a column vector.
+type Matrix [3][3]float64
+
+// Space converts between RGB and Y'CbCr for one colorspace/range
+// combination. All values are 8-bit code values held in float64, not yet
+// rounded to byte - callers round only once they've finished any
+// averaging (e.g. chroma downsampling).
+type Space interface {
+	// ID is the value recorded in the container header so a decoder can
+	// select the matching inverse transform without out-of-band config.
+	ID() byte
+	Name() string
+	RGBToYUV(r, g, b float64) (y, u, v float64)
+	YUVToRGB(y, u, v float64) (r, g, b float64)
+}
+
+type space struct {
+	id      byte
+	name    string
+	forward Matrix // RGB (0-255) -> Y'CbCr (0-255, centered on 128)
+	inverse Matrix // the inverse of forward
+
+	yOffset, yScale float64
+	cOffset, cScale float64
+}
+
+func (s *space) ID() byte     { return s.id }
+func (s *space) Name() string { return s.name }
+
+func (s *space) RGBToYUV(r, g, b float64) (y, u, v float64) {
+	R, G, B := r/255, g/255, b/255
+	yp := s.forward[0][0]*R + s.forward[0][1]*G + s.forward[0][2]*B
+	cb := s.forward[1][0]*R + s.forward[1][1]*G + s.forward[1][2]*B
+	cr := s.forward[2][0]*R + s.forward[2][1]*G + s.forward[2][2]*B
+
+	y = s.yOffset + yp*s.yScale
+	u = s.cOffset + cb*s.cScale
+	v = s.cOffset + cr*s.cScale
+	return
+}
+
+func (s *space) YUVToRGB(y, u, v float64) (r, g, b float64) {
+	yp := (y - s.yOffset) / s.yScale
+	cb := (u - s.cOffset) / s.cScale
+	cr := (v - s.cOffset) / s.cScale
+
+	r = 255 * (s.inverse[0][0]*yp + s.inverse[0][1]*cb + s.inverse[0][2]*cr)
+	g = 255 * (s.inverse[1][0]*yp + s.inverse[1][1]*cb + s.inverse[1][2]*cr)
+	b = 255 * (s.inverse[2][0]*yp + s.inverse[2][1]*cb + s.inverse[2][2]*cr)
+	return
+}
+
+// Registered spaces, keyed by the id recorded in the container header.
+var (
+	Rec601      Space = newSpace(1, "Rec.601", 0.299, 0.114, Limited)
+	Rec709      Space = newSpace(2, "Rec.709", 0.2126, 0.0722, Limited)
+	Rec709Full  Space = newSpace(3, "Rec.709 (full range)", 0.2126, 0.0722, Full)
+	Rec2020     Space = newSpace(4, "Rec.2020", 0.2627, 0.0593, Limited)
+	Rec2020Full Space = newSpace(5, "Rec.2020 (full range)", 0.2627, 0.0593, Full)
+)
+
+var byID = map[byte]Space{
+	Rec601.ID():      Rec601,
+	Rec709.ID():      Rec709,
+	Rec709Full.ID():  Rec709Full,
+	Rec2020.ID():     Rec2020,
+	Rec2020Full.ID(): Rec2020Full,
+}
+
+// ByID looks up a registered Space by the id stored in a container header.
+func ByID(id byte) (Space, error) {
+	s, ok := byID[id]
+	if !ok {
+		return nil, fmt.Errorf("colorspace: unknown colorspace id %d", id)
+	}
+	return s, nil
+}
+
+// newSpace derives the forward/inverse matrices and range parameters for a
+// Y'CbCr space from its Kr/Kb luma coefficients (Kg is implied, since the
+// three always sum to 1), following the standard BT.601/709/2020
+// construction.
+func newSpace(id byte, name string, kr, kb float64, r Range) *space {
+	kg := 1 - kr - kb
+
+	forward := Matrix{
+		{kr, kg, kb},
+		{-kr / (2 * (1 - kb)), -kg / (2 * (1 - kb)), 0.5},
+		{0.5, -kg / (2 * (1 - kr)), -kb / (2 * (1 - kr))},
+	}
+	inverse := Matrix{
+		{1, 0, 2 * (1 - kr)},
+		{1, -(kb / kg) * 2 * (1 - kb), -(kr / kg) * 2 * (1 - kr)},
+		{1, 2 * (1 - kb), 0},
+	}
+
+	yOffset, yScale := 0.0, 255.0
+	cOffset, cScale := 128.0, 255.0
+	if r == Limited {
+		yOffset, yScale = 16, 219
+		cOffset, cScale = 128, 224
+	}
+
+	return &space{
+		id:      id,
+		name:    name,
+		forward: forward,
+		inverse: inverse,
+		yOffset: yOffset,
+		yScale:  yScale,
+		cOffset: cOffset,
+		cScale:  cScale,
+	}
+}
@@ -0,0 +1,53 @@
+package colorspace_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Mvoii/video_codec/colorspace"
+)
+
+func TestRoundTrip(t *testing.T) {
+	spaces := []colorspace.Space{
+		colorspace.Rec601,
+		colorspace.Rec709,
+		colorspace.Rec709Full,
+		colorspace.Rec2020,
+		colorspace.Rec2020Full,
+	}
+
+	samples := [][3]float64{
+		{0, 0, 0},
+		{255, 255, 255},
+		{220, 20, 60},
+		{30, 144, 255},
+		{128, 128, 128},
+	}
+
+	for _, s := range spaces {
+		for _, rgb := range samples {
+			y, u, v := s.RGBToYUV(rgb[0], rgb[1], rgb[2])
+			r, g, b := s.YUVToRGB(y, u, v)
+
+			if math.Abs(r-rgb[0]) > 1.5 || math.Abs(g-rgb[1]) > 1.5 || math.Abs(b-rgb[2]) > 1.5 {
+				t.Errorf("%s: RGB(%v) -> YUV(%v,%v,%v) -> RGB(%v,%v,%v), want ~%v", s.Name(), rgb, y, u, v, r, g, b, rgb)
+			}
+		}
+	}
+}
+
+func TestByID(t *testing.T) {
+	for _, want := range []colorspace.Space{colorspace.Rec601, colorspace.Rec709, colorspace.Rec709Full, colorspace.Rec2020, colorspace.Rec2020Full} {
+		got, err := colorspace.ByID(want.ID())
+		if err != nil {
+			t.Fatalf("ByID(%d): %v", want.ID(), err)
+		}
+		if got != want {
+			t.Fatalf("ByID(%d) = %v, want %v", want.ID(), got.Name(), want.Name())
+		}
+	}
+
+	if _, err := colorspace.ByID(255); err == nil {
+		t.Fatal("ByID(255) should have failed for an unregistered id")
+	}
+}
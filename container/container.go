@@ -0,0 +1,184 @@
+// Package container defines a small chunked file format for storing encoded
+// video streams, loosely inspired by IVF/FLV tag structures: a fixed magic
+// and header describe everything needed to decode the stream, followed by a
+// sequence of per-frame packets. There are no out-of-band parameters - a
+// conforming reader can decode a file knowing nothing but its bytes.
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Magic identifies a video_codec container file.
+var Magic = [4]byte{'V', 'C', 'F', '1'}
+
+// Chroma subsampling identifiers stored in Header.ChromaSubsampling.
+const (
+	Chroma420 uint8 = iota + 1
+)
+
+// Packet flags, stored in PacketHeader.Flags.
+const (
+	FlagKeyframe byte = 1 << 0
+	FlagPFrame   byte = 1 << 1
+
+	// FlagEndOfStream marks a zero-payload sentinel packet written just
+	// before the trailer index, so a sequential reader knows to stop
+	// before it rather than trying to parse index bytes as a packet.
+	FlagEndOfStream byte = 1 << 2
+)
+
+// Header is the fixed-size file header written once at the start of a
+// container. It carries everything a decoder needs to make sense of the
+// packets that follow.
+type Header struct {
+	Width             uint32
+	Height            uint32
+	FramerateNum      uint32
+	FramerateDen      uint32
+	ChromaSubsampling uint8
+	ColorspaceID      uint8
+	CodecVersion      uint8
+
+	// IntraQuality is the 1-100 quality factor keyframes' 8x8 DCT
+	// quantization matrices were scaled by; see package intra.
+	IntraQuality uint8
+}
+
+// PacketHeader precedes every frame's payload.
+type PacketHeader struct {
+	Size  uint32
+	PTS   uint64
+	Flags byte
+}
+
+// WriteHeader writes the magic followed by h to w.
+func WriteHeader(w io.Writer, h Header) error {
+	if _, err := w.Write(Magic[:]); err != nil {
+		return fmt.Errorf("container: write magic: %w", err)
+	}
+	if err := binary.Write(w, binary.BigEndian, h); err != nil {
+		return fmt.Errorf("container: write header: %w", err)
+	}
+	return nil
+}
+
+// ReadHeader reads and validates the magic, then decodes the Header that
+// follows it.
+func ReadHeader(r io.Reader) (Header, error) {
+	var magic [4]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return Header{}, fmt.Errorf("container: read magic: %w", err)
+	}
+	if magic != Magic {
+		return Header{}, fmt.Errorf("container: bad magic %q, not a video_codec file", magic)
+	}
+
+	var h Header
+	if err := binary.Read(r, binary.BigEndian, &h); err != nil {
+		return Header{}, fmt.Errorf("container: read header: %w", err)
+	}
+	return h, nil
+}
+
+// WritePacket writes a single packet - header plus payload - to w.
+func WritePacket(w io.Writer, pts uint64, flags byte, payload []byte) error {
+	ph := PacketHeader{Size: uint32(len(payload)), PTS: pts, Flags: flags}
+	if err := binary.Write(w, binary.BigEndian, ph); err != nil {
+		return fmt.Errorf("container: write packet header: %w", err)
+	}
+	if _, err := w.Write(payload); err != nil {
+		return fmt.Errorf("container: write packet payload: %w", err)
+	}
+	return nil
+}
+
+// ReadPacket reads a single packet header and its payload from r.
+func ReadPacket(r io.Reader) (PacketHeader, []byte, error) {
+	var ph PacketHeader
+	if err := binary.Read(r, binary.BigEndian, &ph); err != nil {
+		return PacketHeader{}, nil, err
+	}
+
+	payload := make([]byte, ph.Size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return PacketHeader{}, nil, fmt.Errorf("container: read packet payload: %w", err)
+	}
+	return ph, payload, nil
+}
+
+// HeaderSize is the number of bytes WriteHeader writes: the magic plus the
+// fixed-size Header. Callers that need to track byte offsets as they
+// write packets (to build a seek index, for instance) use this as their
+// starting offset.
+func HeaderSize() int64 {
+	return int64(len(Magic)) + int64(binary.Size(Header{}))
+}
+
+// PacketHeaderSize is the number of bytes a PacketHeader occupies on the
+// wire, ahead of its payload.
+func PacketHeaderSize() int64 {
+	return int64(binary.Size(PacketHeader{}))
+}
+
+// IndexEntry describes one packet in the trailer index: its presentation
+// timestamp, its byte offset from the start of the file, and its packet
+// flags (so a seeking reader can tell keyframes from P-frames without
+// reading the packet itself).
+type IndexEntry struct {
+	PTS    uint64
+	Offset uint64
+	Flags  byte
+}
+
+// Footer is the fixed-size trailer written as the very last bytes of a
+// container file, FLV-style: it points back to where the index begins so
+// a seeking reader can find it without scanning the whole file.
+type Footer struct {
+	IndexOffset uint64
+	IndexCount  uint32
+}
+
+// WriteIndex writes entries - the seek index built while a stream was
+// encoded - followed by a Footer pointing back to indexOffset, the byte
+// offset entries itself starts at.
+func WriteIndex(w io.Writer, entries []IndexEntry, indexOffset uint64) error {
+	for i, e := range entries {
+		if err := binary.Write(w, binary.BigEndian, e); err != nil {
+			return fmt.Errorf("container: write index entry %d: %w", i, err)
+		}
+	}
+	f := Footer{IndexOffset: indexOffset, IndexCount: uint32(len(entries))}
+	if err := binary.Write(w, binary.BigEndian, f); err != nil {
+		return fmt.Errorf("container: write footer: %w", err)
+	}
+	return nil
+}
+
+// ReadIndex reads the trailer index out of r: it seeks to the fixed-size
+// footer at the very end of the file, follows it back to where the index
+// starts, and returns the entries found there. r's position afterwards is
+// just past the index, i.e. at the footer.
+func ReadIndex(r io.ReadSeeker) ([]IndexEntry, error) {
+	footerSize := int64(binary.Size(Footer{}))
+	if _, err := r.Seek(-footerSize, io.SeekEnd); err != nil {
+		return nil, fmt.Errorf("container: seek to footer: %w", err)
+	}
+	var f Footer
+	if err := binary.Read(r, binary.BigEndian, &f); err != nil {
+		return nil, fmt.Errorf("container: read footer: %w", err)
+	}
+
+	if _, err := r.Seek(int64(f.IndexOffset), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("container: seek to index: %w", err)
+	}
+	entries := make([]IndexEntry, f.IndexCount)
+	for i := range entries {
+		if err := binary.Read(r, binary.BigEndian, &entries[i]); err != nil {
+			return nil, fmt.Errorf("container: read index entry %d: %w", i, err)
+		}
+	}
+	return entries, nil
+}
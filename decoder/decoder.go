@@ -0,0 +1,308 @@
+// Package decoder reads a video_codec container stream back into RGB24
+// frames, reversing the keyframe/delta + RLE/DEFLATE pipeline in package
+// encoder. Like the encoder, it holds only the current and previous
+// reconstructed frame in memory, via framepool, so memory use stays
+// constant regardless of stream length.
+package decoder
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Mvoii/video_codec/colorspace"
+	"github.com/Mvoii/video_codec/container"
+	"github.com/Mvoii/video_codec/framepool"
+	"github.com/Mvoii/video_codec/intra"
+	"github.com/Mvoii/video_codec/motion"
+	"github.com/Mvoii/video_codec/quant"
+	"github.com/Mvoii/video_codec/ratecontrol"
+	"github.com/Mvoii/video_codec/rle"
+)
+
+// Decoder reads frames from an underlying io.Reader holding a video_codec
+// container stream.
+type Decoder struct {
+	r      io.Reader
+	header container.Header
+	cs     colorspace.Space
+
+	pool      *framepool.Pool
+	prevFrame *framepool.Frame // nil before the keyframe
+	pts       int64
+
+	lumaQuant, chromaQuant intra.QuantMatrix
+
+	// index is the trailer seek index, lazily read by the first Seek call.
+	index []container.IndexEntry
+}
+
+// NewDecoder reads the container header from r and returns a Decoder ready
+// to produce frames via ReadFrame, along with the header itself so callers
+// can inspect stream parameters without any out-of-band configuration. The
+// colorspace to decode with is selected from the header's ColorspaceID, so
+// no separate configuration is needed.
+func NewDecoder(r io.Reader) (*Decoder, *container.Header, error) {
+	h, err := container.ReadHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err := colorspace.ByID(h.ColorspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	props := framepool.FrameProperties{Width: int(h.Width), Height: int(h.Height), Subsampling: h.ChromaSubsampling}
+	d := &Decoder{
+		r:           r,
+		header:      h,
+		cs:          cs,
+		pool:        framepool.New(props),
+		lumaQuant:   intra.LumaQuantMatrix(int(h.IntraQuality)),
+		chromaQuant: intra.ChromaQuantMatrix(int(h.IntraQuality)),
+	}
+	return d, &h, nil
+}
+
+// ReadFrame decodes and returns the next frame as packed RGB24. It returns
+// io.EOF once the stream is exhausted.
+func (d *Decoder) ReadFrame() ([]byte, error) {
+	ph, payload, err := container.ReadPacket(d.r)
+	if err != nil {
+		return nil, err
+	}
+	if ph.Flags&container.FlagEndOfStream != 0 {
+		return nil, io.EOF
+	}
+
+	cur := d.pool.Get(d.pts)
+	d.pts++
+
+	if ph.Flags&container.FlagKeyframe != 0 {
+		if err := d.decodeKeyframe(payload, cur); err != nil {
+			return nil, err
+		}
+	} else {
+		if d.prevFrame == nil {
+			return nil, fmt.Errorf("decoder: P-frame with no preceding keyframe")
+		}
+		if err := d.decodePFrame(payload, cur); err != nil {
+			return nil, err
+		}
+	}
+
+	if d.prevFrame != nil {
+		d.pool.Put(d.prevFrame)
+	}
+	d.prevFrame = cur
+	return yuv420ToRGB(cur, int(d.header.Width), int(d.header.Height), d.cs), nil
+}
+
+// SeekPTS moves the decoder to the keyframe at or immediately before pts,
+// re-priming the delta reference so the next ReadFrame starts cleanly from
+// there. It requires the underlying reader to be an io.ReadSeeker (e.g. a
+// seekable file), since it jumps using the trailer index rather than
+// reading sequentially.
+//
+// Named SeekPTS rather than Seek so `go vet`'s stdmethods check doesn't
+// mistake it for io.Seeker's byte-offset-and-whence Seek.
+func (d *Decoder) SeekPTS(pts int64) error {
+	rs, ok := d.r.(io.ReadSeeker)
+	if !ok {
+		return fmt.Errorf("decoder: Seek requires the container to be read from an io.ReadSeeker")
+	}
+
+	if d.index == nil {
+		idx, err := container.ReadIndex(rs)
+		if err != nil {
+			return fmt.Errorf("decoder: read seek index: %w", err)
+		}
+		d.index = idx
+	}
+
+	var target *container.IndexEntry
+	for i := range d.index {
+		e := &d.index[i]
+		if e.Flags&container.FlagKeyframe == 0 || int64(e.PTS) > pts {
+			continue
+		}
+		if target == nil || e.PTS > target.PTS {
+			target = e
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("decoder: no keyframe at or before pts %d", pts)
+	}
+
+	if _, err := rs.Seek(int64(target.Offset), io.SeekStart); err != nil {
+		return fmt.Errorf("decoder: seek to offset %d: %w", target.Offset, err)
+	}
+
+	if d.prevFrame != nil {
+		d.pool.Put(d.prevFrame)
+		d.prevFrame = nil
+	}
+	d.pts = int64(target.PTS)
+	return nil
+}
+
+// decodeKeyframe reverses encoder.encodeKeyframe: it inflates the combined
+// stream, reads the quantizer byte rate control scaled this frame's quant
+// matrices by, splits the rest back into its length-prefixed Y and U intra
+// streams plus the trailing V stream, and intra-decodes each into dst.
+func (d *Decoder) decodeKeyframe(payload []byte, dst *framepool.Frame) error {
+	w, h := int(d.header.Width), int(d.header.Height)
+
+	inflated, err := inflate(payload)
+	if err != nil {
+		return err
+	}
+	r := bytes.NewReader(inflated)
+
+	q, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("decoder: keyframe quantizer: %w", err)
+	}
+	scale := float64(q) / float64(ratecontrol.RefQuantizer)
+	lumaQuant := intra.ScaleMatrix(d.lumaQuant, scale)
+	chromaQuant := intra.ScaleMatrix(d.chromaQuant, scale)
+
+	var yLen, uLen uint32
+	if err := binary.Read(r, binary.BigEndian, &yLen); err != nil {
+		return fmt.Errorf("decoder: keyframe Y length: %w", err)
+	}
+	y := make([]byte, yLen)
+	if _, err := io.ReadFull(r, y); err != nil {
+		return fmt.Errorf("decoder: keyframe Y stream: %w", err)
+	}
+	if err := binary.Read(r, binary.BigEndian, &uLen); err != nil {
+		return fmt.Errorf("decoder: keyframe U length: %w", err)
+	}
+	u := make([]byte, uLen)
+	if _, err := io.ReadFull(r, u); err != nil {
+		return fmt.Errorf("decoder: keyframe U stream: %w", err)
+	}
+	v, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("decoder: keyframe V stream: %w", err)
+	}
+
+	decodedY, err := intra.Decode(y, w, h, lumaQuant)
+	if err != nil {
+		return fmt.Errorf("decoder: keyframe Y: %w", err)
+	}
+	decodedU, err := intra.Decode(u, w/2, h/2, chromaQuant)
+	if err != nil {
+		return fmt.Errorf("decoder: keyframe U: %w", err)
+	}
+	decodedV, err := intra.Decode(v, w/2, h/2, chromaQuant)
+	if err != nil {
+		return fmt.Errorf("decoder: keyframe V: %w", err)
+	}
+
+	copy(dst.Y, decodedY)
+	copy(dst.U, decodedU)
+	copy(dst.V, decodedV)
+	return nil
+}
+
+// decodePFrame reverses encoder.encodePFrame: it splits off the quantizer
+// and per-macroblock motion vectors, inflates, un-RLEs and dequantizes the
+// residual planes, and motion-compensates against d.prevFrame to
+// reconstruct dst in place.
+func (d *Decoder) decodePFrame(payload []byte, dst *framepool.Frame) error {
+	w, h := int(d.header.Width), int(d.header.Height)
+	cols, rows := w/motion.BlockSize, h/motion.BlockSize
+	numMVs := cols * rows
+
+	if len(payload) < 1+numMVs*2 {
+		return fmt.Errorf("decoder: P-frame payload too short for %d motion vectors", numMVs)
+	}
+	q := int(payload[0])
+	mvs := decodeMVs(payload[1 : 1+numMVs*2])
+
+	inflated, err := inflate(payload[1+numMVs*2:])
+	if err != nil {
+		return err
+	}
+	quantized, err := rle.Decode(inflated)
+	if err != nil {
+		return err
+	}
+	if len(quantized) != w*h*3/2 {
+		return fmt.Errorf("decoder: residual is %d bytes, want %d", len(quantized), w*h*3/2)
+	}
+	residual := quant.Dequantize(quantized, q)
+	residualY, residualU, residualV := planes(residual, w, h)
+
+	prev := d.prevFrame
+	predictedY := motion.Predict(prev.Y, w, h, motion.BlockSize, 1, mvs)
+	predictedU := motion.Predict(prev.U, w/2, h/2, motion.BlockSize/2, 2, mvs)
+	predictedV := motion.Predict(prev.V, w/2, h/2, motion.BlockSize/2, 2, mvs)
+
+	copy(dst.Y, motion.Reconstruct(predictedY, residualY))
+	copy(dst.U, motion.Reconstruct(predictedU, residualU))
+	copy(dst.V, motion.Reconstruct(predictedV, residualV))
+	return nil
+}
+
+// decodeMVs is the inverse of encoder.encodeMVs.
+func decodeMVs(data []byte) []motion.MV {
+	mvs := make([]motion.MV, len(data)/2)
+	for i := range mvs {
+		mvs[i] = motion.MV{DX: int8(data[2*i]), DY: int8(data[2*i+1])}
+	}
+	return mvs
+}
+
+// planes splits a planar YUV420 buffer into its Y, U and V slices.
+func planes(yuv []byte, width, height int) (y, u, v []byte) {
+	ySize := width * height
+	cSize := ySize / 4
+	return yuv[:ySize], yuv[ySize : ySize+cSize], yuv[ySize+cSize:]
+}
+
+// inflate reverses deflate, returning the original bytes written by the
+// encoder.
+func inflate(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r); err != nil {
+		return nil, fmt.Errorf("decoder: inflate: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// yuv420ToRGB converts a reconstructed frame back into packed RGB24, using
+// the inverse transform of the colorspace the encoder recorded in the
+// container header.
+func yuv420ToRGB(f *framepool.Frame, width, height int, cs colorspace.Space) []byte {
+	rgb := make([]byte, 0, width*height*3)
+	for j := 0; j < height; j++ {
+		for k := 0; k < width; k++ {
+			y := float64(f.Y[j*width+k])
+			u := float64(f.U[(j/2)*(width/2)+(k/2)])
+			v := float64(f.V[(j/2)*(width/2)+(k/2)])
+
+			r, g, b := cs.YUVToRGB(y, u, v)
+			rgb = append(rgb, roundByte(r), roundByte(g), roundByte(b))
+		}
+	}
+	return rgb
+}
+
+// roundByte rounds and clamps a code value into the 0-255 byte range.
+func roundByte(x float64) byte {
+	x = math.Round(x)
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return byte(x)
+}
@@ -0,0 +1,115 @@
+package decoder_test
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/Mvoii/video_codec/decoder"
+	"github.com/Mvoii/video_codec/encoder"
+)
+
+// solidFrame returns a width*height RGB24 frame filled with one color.
+func solidFrame(width, height int, r, g, b byte) []byte {
+	frame := make([]byte, width*height*3)
+	for i := 0; i < width*height; i++ {
+		frame[3*i], frame[3*i+1], frame[3*i+2] = r, g, b
+	}
+	return frame
+}
+
+// TestSeekMatchesSequentialDecode encodes a stream with a short GOP,
+// decodes it sequentially to get a reference, then seeks to a handful of
+// random keyframe timestamps and checks each one decodes byte-exact
+// against the sequential run.
+func TestSeekMatchesSequentialDecode(t *testing.T) {
+	const width, height = 16, 16
+	const keyframeInterval = 4
+	const numFrames = 24
+
+	rng := rand.New(rand.NewSource(1))
+	frames := make([][]byte, numFrames)
+	for i := range frames {
+		frames[i] = solidFrame(width, height, byte(rng.Intn(256)), byte(rng.Intn(256)), byte(rng.Intn(256)))
+	}
+
+	cfg := encoder.DefaultConfig(width, height)
+	cfg.KeyframeInterval = keyframeInterval
+
+	var buf bytes.Buffer
+	enc, err := encoder.NewEncoder(&buf, cfg)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	for i, frame := range frames {
+		if err := enc.WriteFrame(frame); err != nil {
+			t.Fatalf("WriteFrame(%d): %v", i, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	encoded := buf.Bytes()
+
+	dec, _, err := decoder.NewDecoder(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+	sequential := make([][]byte, numFrames)
+	for i := range sequential {
+		got, err := dec.ReadFrame()
+		if err != nil {
+			t.Fatalf("sequential ReadFrame(%d): %v", i, err)
+		}
+		sequential[i] = got
+	}
+	if _, err := dec.ReadFrame(); err != io.EOF {
+		t.Fatalf("final sequential ReadFrame error = %v, want io.EOF", err)
+	}
+
+	for _, pts := range []int64{0, keyframeInterval, 2 * keyframeInterval, numFrames - keyframeInterval} {
+		seekDec, _, err := decoder.NewDecoder(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("NewDecoder for seek to %d: %v", pts, err)
+		}
+		if err := seekDec.SeekPTS(pts); err != nil {
+			t.Fatalf("SeekPTS(%d): %v", pts, err)
+		}
+		got, err := seekDec.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame after SeekPTS(%d): %v", pts, err)
+		}
+		if !bytes.Equal(got, sequential[pts]) {
+			t.Fatalf("seek to pts %d did not match sequential decode", pts)
+		}
+	}
+}
+
+// TestSeekRequiresReadSeeker checks that Seek on a non-seekable reader
+// fails cleanly instead of misbehaving.
+func TestSeekRequiresReadSeeker(t *testing.T) {
+	const width, height = 16, 16
+	cfg := encoder.DefaultConfig(width, height)
+	cfg.KeyframeInterval = 4
+
+	var buf bytes.Buffer
+	enc, err := encoder.NewEncoder(&buf, cfg)
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	if err := enc.WriteFrame(solidFrame(width, height, 10, 20, 30)); err != nil {
+		t.Fatalf("WriteFrame: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec, _, err := decoder.NewDecoder(io.NopCloser(&buf))
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+	if err := dec.SeekPTS(0); err == nil {
+		t.Fatal("SeekPTS on a non-seekable reader should fail")
+	}
+}
@@ -0,0 +1,412 @@
+// Package encoder turns a sequence of raw RGB24 frames into a video_codec
+// container stream: the first frame is kept as a keyframe, every
+// subsequent frame is stored as a delta against the previous one, and both
+// are run through RLE + DEFLATE before being written out as packets. Only
+// the current and previous reconstructed frame are ever held in memory,
+// and their buffers are reused via framepool rather than reallocated per
+// frame, so memory use stays constant regardless of stream length.
+package encoder
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Mvoii/video_codec/colorspace"
+	"github.com/Mvoii/video_codec/container"
+	"github.com/Mvoii/video_codec/framepool"
+	"github.com/Mvoii/video_codec/intra"
+	"github.com/Mvoii/video_codec/motion"
+	"github.com/Mvoii/video_codec/quant"
+	"github.com/Mvoii/video_codec/ratecontrol"
+	"github.com/Mvoii/video_codec/rle"
+)
+
+// Config describes the video stream being encoded. It is recorded in the
+// container header so a decoder never needs out-of-band parameters.
+type Config struct {
+	Width  int
+	Height int
+
+	// FramerateNum/FramerateDen express the framerate as a fraction, e.g.
+	// 30000/1001 for 29.97fps.
+	FramerateNum int
+	FramerateDen int
+
+	ChromaSubsampling uint8
+	ColorSpace        colorspace.Space
+
+	// Quality controls the quantization matrices keyframes' 8x8 DCT
+	// coefficients are divided by, 1 (smallest, lossiest) to 100 (largest,
+	// least lossy). See package intra.
+	Quality int
+
+	// KeyframeInterval is the GOP length: every KeyframeInterval-th frame
+	// (frame 0, KeyframeInterval, 2*KeyframeInterval, ...) is intra-coded
+	// rather than stored as a delta, bounding how far Seek ever has to
+	// decode sequentially to reach a requested timestamp.
+	KeyframeInterval int
+}
+
+// DefaultConfig returns a Config for a width x height stream at 25fps,
+// using 4:2:0 chroma subsampling, Rec.601 (the conventional choice for SD
+// content), a keyframe quality of 85 and a 250-frame GOP.
+func DefaultConfig(width, height int) Config {
+	return Config{
+		Width:             width,
+		Height:            height,
+		FramerateNum:      25,
+		FramerateDen:      1,
+		ChromaSubsampling: container.Chroma420,
+		ColorSpace:        colorspace.Rec601,
+		Quality:           85,
+		KeyframeInterval:  250,
+	}
+}
+
+// Encoder writes frames to an underlying io.Writer as a video_codec
+// container stream.
+type Encoder struct {
+	w   io.Writer
+	cfg Config
+	pts uint64
+
+	pool      *framepool.Pool
+	prevFrame *framepool.Frame // nil before the keyframe
+
+	lumaQuant, chromaQuant intra.QuantMatrix
+
+	offset int64 // byte offset of the next packet, for the trailer index
+	index  []container.IndexEntry
+
+	// Scratch chroma buffers, reused across WriteFrame calls: full-
+	// resolution U/V kept in the float domain until after downsampling, so
+	// the 2x2 average isn't computed over already-rounded samples.
+	uFull, vFull []float64
+
+	rc *ratecontrol.Controller
+}
+
+// NewEncoder writes the container header to w and returns an Encoder ready
+// to accept frames via WriteFrame.
+func NewEncoder(w io.Writer, cfg Config) (*Encoder, error) {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return nil, fmt.Errorf("encoder: invalid dimensions %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.FramerateNum <= 0 || cfg.FramerateDen <= 0 {
+		return nil, fmt.Errorf("encoder: invalid framerate %d/%d", cfg.FramerateNum, cfg.FramerateDen)
+	}
+	if cfg.Width%motion.BlockSize != 0 || cfg.Height%motion.BlockSize != 0 {
+		return nil, fmt.Errorf("encoder: dimensions %dx%d must be multiples of %d for motion estimation", cfg.Width, cfg.Height, motion.BlockSize)
+	}
+	if cfg.ColorSpace == nil {
+		return nil, fmt.Errorf("encoder: ColorSpace must be set")
+	}
+	if cfg.Quality < 1 || cfg.Quality > 100 {
+		return nil, fmt.Errorf("encoder: Quality must be 1..100, got %d", cfg.Quality)
+	}
+	if cfg.KeyframeInterval <= 0 {
+		return nil, fmt.Errorf("encoder: KeyframeInterval must be positive, got %d", cfg.KeyframeInterval)
+	}
+
+	h := container.Header{
+		Width:             uint32(cfg.Width),
+		Height:            uint32(cfg.Height),
+		FramerateNum:      uint32(cfg.FramerateNum),
+		FramerateDen:      uint32(cfg.FramerateDen),
+		ChromaSubsampling: cfg.ChromaSubsampling,
+		ColorspaceID:      cfg.ColorSpace.ID(),
+		IntraQuality:      uint8(cfg.Quality),
+	}
+	if err := container.WriteHeader(w, h); err != nil {
+		return nil, err
+	}
+
+	props := framepool.FrameProperties{Width: cfg.Width, Height: cfg.Height, Subsampling: cfg.ChromaSubsampling}
+	return &Encoder{
+		w:           w,
+		cfg:         cfg,
+		pool:        framepool.New(props),
+		uFull:       make([]float64, cfg.Width*cfg.Height),
+		vFull:       make([]float64, cfg.Width*cfg.Height),
+		lumaQuant:   intra.LumaQuantMatrix(cfg.Quality),
+		chromaQuant: intra.ChromaQuantMatrix(cfg.Quality),
+		offset:      container.HeaderSize(),
+	}, nil
+}
+
+// SetRateControl enables rate control: mode selects whether this run is
+// collecting Pass1 stats or spending a Pass2 budget derived from them,
+// bitrate is the Pass2 target in bits per second, and statsPath is where
+// Pass1 writes (and Pass2 reads) per-frame stats. It must be called before
+// the first WriteFrame.
+func (e *Encoder) SetRateControl(mode ratecontrol.Mode, bitrate int, statsPath string) error {
+	rc, err := ratecontrol.New(mode, bitrate, e.cfg.FramerateNum, e.cfg.FramerateDen, statsPath)
+	if err != nil {
+		return err
+	}
+	e.rc = rc
+	return nil
+}
+
+// WriteFrame encodes a single RGB24 frame (width*height*3 bytes, packed
+// r,g,b per pixel) and writes it as the next packet.
+func (e *Encoder) WriteFrame(rgb []byte) error {
+	want := e.cfg.Width * e.cfg.Height * 3
+	if len(rgb) != want {
+		return fmt.Errorf("encoder: frame is %d bytes, want %d", len(rgb), want)
+	}
+
+	cur := e.pool.Get(int64(e.pts))
+	e.rgbToYUV420(rgb, cur)
+
+	isKeyframe := e.prevFrame == nil || e.pts%uint64(e.cfg.KeyframeInterval) == 0
+
+	var payload []byte
+	var flags byte
+	var err error
+	if isKeyframe {
+		flags = container.FlagKeyframe
+		payload, err = e.encodeKeyframe(cur)
+	} else {
+		flags = container.FlagPFrame
+		payload, err = e.encodePFrame(cur)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := container.WritePacket(e.w, e.pts, flags, payload); err != nil {
+		return err
+	}
+	e.index = append(e.index, container.IndexEntry{PTS: e.pts, Offset: uint64(e.offset), Flags: flags})
+	e.offset += container.PacketHeaderSize() + int64(len(payload))
+
+	if e.prevFrame != nil {
+		e.pool.Put(e.prevFrame)
+	}
+	e.prevFrame = cur
+	e.pts++
+	return nil
+}
+
+// Close writes an end-of-stream sentinel packet and the trailer seek
+// index, flushes any buffered state (including a Pass1 rate control stats
+// file, if one is in use) and closes the underlying writer, if it
+// implements io.Closer.
+func (e *Encoder) Close() error {
+	if err := container.WritePacket(e.w, e.pts, container.FlagEndOfStream, nil); err != nil {
+		return err
+	}
+	e.offset += container.PacketHeaderSize()
+
+	if err := container.WriteIndex(e.w, e.index, uint64(e.offset)); err != nil {
+		return err
+	}
+	if err := e.rc.Close(); err != nil {
+		return err
+	}
+	if c, ok := e.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// encodeKeyframe runs each of cur's planes through the intra 8x8 DCT
+// pipeline and DEFLATEs the combined result. Rate control gets a say here
+// too: e.rc.Quantizer(SubtypeI) scales the Quality-derived quant matrices
+// up or down for this frame, same as it scales the residual quantizer for
+// P-frames, so a two-pass Pass2 run actually constrains keyframe size
+// instead of only ever emitting them at the fixed Config.Quality.
+//
+// Before returning, it overwrites cur's planes with the lossy pixels
+// intra.Decode would actually reconstruct from the stream just encoded.
+// WriteFrame stores cur as e.prevFrame, and that's what every subsequent
+// P-frame predicts against - it has to match the decoder's reconstruction
+// exactly, or the encoder and decoder would disagree about the reference
+// frame and any DCT quantization error would never get corrected.
+func (e *Encoder) encodeKeyframe(cur *framepool.Frame) ([]byte, error) {
+	w, h := e.cfg.Width, e.cfg.Height
+
+	q := e.rc.Quantizer(ratecontrol.SubtypeI)
+	scale := float64(q) / float64(ratecontrol.RefQuantizer)
+	lumaQuant := intra.ScaleMatrix(e.lumaQuant, scale)
+	chromaQuant := intra.ScaleMatrix(e.chromaQuant, scale)
+
+	y, err := intra.Encode(cur.Y, w, h, lumaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe Y: %w", err)
+	}
+	u, err := intra.Encode(cur.U, w/2, h/2, chromaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe U: %w", err)
+	}
+	v, err := intra.Encode(cur.V, w/2, h/2, chromaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe V: %w", err)
+	}
+
+	decodedY, err := intra.Decode(y, w, h, lumaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe Y reconstruction: %w", err)
+	}
+	decodedU, err := intra.Decode(u, w/2, h/2, chromaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe U reconstruction: %w", err)
+	}
+	decodedV, err := intra.Decode(v, w/2, h/2, chromaQuant)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: keyframe V reconstruction: %w", err)
+	}
+	copy(cur.Y, decodedY)
+	copy(cur.U, decodedU)
+	copy(cur.V, decodedV)
+
+	// The three intra streams are variable-length (their RLE-encoded size
+	// depends on image content), so - unlike the fixed-size raw planes
+	// this replaces - Y and U need explicit length prefixes for the
+	// decoder to split them back apart; V runs to the end of the payload.
+	// The quantizer byte up front lets the decoder rebuild the same scaled
+	// matrices this frame was encoded with.
+	var framed bytes.Buffer
+	framed.WriteByte(byte(q))
+	binary.Write(&framed, binary.BigEndian, uint32(len(y)))
+	framed.Write(y)
+	binary.Write(&framed, binary.BigEndian, uint32(len(u)))
+	framed.Write(u)
+	framed.Write(v)
+
+	payload, err := deflate(framed.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.rc.Observe(ratecontrol.SubtypeI, q, len(payload)*8); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// encodePFrame motion-compensates cur against e.prevFrame and returns the
+// packet payload: a quantizer byte, a per-macroblock (dx, dy) header, then
+// the RLE+DEFLATE-compressed quantized residual planes.
+//
+// Before returning, it overwrites cur's planes with the lossy pixels the
+// decoder will actually reconstruct - motion.Reconstruct against the
+// dequantized residual, same as decodePFrame does - for the same reason
+// encodeKeyframe does: cur becomes e.prevFrame, the reference the next
+// frame predicts against, so it has to carry forward this frame's
+// quantization error rather than drift from it.
+func (e *Encoder) encodePFrame(cur *framepool.Frame) ([]byte, error) {
+	w, h := e.cfg.Width, e.cfg.Height
+	prev := e.prevFrame
+
+	mvs := motion.EstimateDiamond(cur.Y, prev.Y, w, h)
+
+	predictedY := motion.Predict(prev.Y, w, h, motion.BlockSize, 1, mvs)
+	predictedU := motion.Predict(prev.U, w/2, h/2, motion.BlockSize/2, 2, mvs)
+	predictedV := motion.Predict(prev.V, w/2, h/2, motion.BlockSize/2, 2, mvs)
+
+	residual := make([]byte, 0, len(cur.Y)+len(cur.U)+len(cur.V))
+	residual = append(residual, motion.Residual(cur.Y, predictedY)...)
+	residual = append(residual, motion.Residual(cur.U, predictedU)...)
+	residual = append(residual, motion.Residual(cur.V, predictedV)...)
+
+	q := e.rc.Quantizer(ratecontrol.SubtypeP)
+	quantized := quant.Quantize(residual, q)
+	compressed, err := deflate(rle.Encode(quantized))
+	if err != nil {
+		return nil, err
+	}
+
+	dequantized := quant.Dequantize(quantized, q)
+	ySize, uSize := len(cur.Y), len(cur.U)
+	copy(cur.Y, motion.Reconstruct(predictedY, dequantized[:ySize]))
+	copy(cur.U, motion.Reconstruct(predictedU, dequantized[ySize:ySize+uSize]))
+	copy(cur.V, motion.Reconstruct(predictedV, dequantized[ySize+uSize:]))
+
+	payload := make([]byte, 0, 1+len(mvs)*2+len(compressed))
+	payload = append(payload, byte(q))
+	payload = append(payload, encodeMVs(mvs)...)
+	payload = append(payload, compressed...)
+
+	if err := e.rc.Observe(ratecontrol.SubtypeP, q, len(payload)*8); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// encodeMVs serializes a motion vector grid as two bytes per block: dx
+// then dy.
+func encodeMVs(mvs []motion.MV) []byte {
+	out := make([]byte, 0, len(mvs)*2)
+	for _, mv := range mvs {
+		out = append(out, byte(mv.DX), byte(mv.DY))
+	}
+	return out
+}
+
+// deflate runs the concatenation of parts through the standard library's
+// best-compression DEFLATE writer, without needing them joined into one
+// slice first.
+func deflate(parts ...[]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, fmt.Errorf("encoder: new flate writer: %w", err)
+	}
+	for _, p := range parts {
+		if _, err := w.Write(p); err != nil {
+			return nil, fmt.Errorf("encoder: flate write: %w", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("encoder: flate close: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rgbToYUV420 converts a packed RGB24 frame into planar YUV420, writing
+// directly into dst's pooled Y/U/V buffers using the configured
+// colorspace. U and V are accumulated in the encoder's scratch float64
+// buffers until after the 2x2 downsampling average, so the average isn't
+// computed over already-rounded, signed-range-shifted chroma samples.
+func (e *Encoder) rgbToYUV420(rgb []byte, dst *framepool.Frame) {
+	width, height := e.cfg.Width, e.cfg.Height
+	cs := e.cfg.ColorSpace
+
+	for j := 0; j < width*height; j++ {
+		r, g, b := float64(rgb[3*j]), float64(rgb[3*j+1]), float64(rgb[3*j+2])
+
+		y, u, v := cs.RGBToYUV(r, g, b)
+
+		dst.Y[j] = roundByte(y)
+		e.uFull[j] = u
+		e.vFull[j] = v
+	}
+
+	for x := 0; x < height; x += 2 {
+		for y := 0; y < width; y += 2 {
+			u := (e.uFull[x*width+y] + e.uFull[x*width+y+1] + e.uFull[(x+1)*width+y] + e.uFull[(x+1)*width+y+1]) / 4
+			v := (e.vFull[x*width+y] + e.vFull[x*width+y+1] + e.vFull[(x+1)*width+y] + e.vFull[(x+1)*width+y+1]) / 4
+
+			dst.U[x/2*width/2+y/2] = roundByte(u)
+			dst.V[x/2*width/2+y/2] = roundByte(v)
+		}
+	}
+}
+
+// roundByte rounds and clamps a code value into the 0-255 byte range.
+func roundByte(x float64) byte {
+	x = math.Round(x)
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return byte(x)
+}
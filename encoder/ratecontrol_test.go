@@ -0,0 +1,154 @@
+package encoder_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mvoii/video_codec/decoder"
+	"github.com/Mvoii/video_codec/encoder"
+	"github.com/Mvoii/video_codec/ratecontrol"
+)
+
+// noisyFrame returns a width*height RGB24 frame with enough high-frequency
+// detail that DCT quantization actually changes its encoded size (a solid
+// color wouldn't: its residual keyframe coefficients are zero regardless
+// of quantizer).
+func noisyFrame(width, height, seed int) []byte {
+	frame := make([]byte, width*height*3)
+	for i := 0; i < width*height; i++ {
+		v := byte((i*7 + seed*31) % 256)
+		frame[3*i], frame[3*i+1], frame[3*i+2] = v, byte(v/2+64), byte(255-v)
+	}
+	return frame
+}
+
+// TestTwoPassConstrainsKeyframeSize checks that Pass2 rate control scales
+// keyframe quantization to hit the target bitrate, not just P-frames: an
+// all-keyframe stream (KeyframeInterval 1) encoded at a low target
+// bitrate should come out smaller than the same stream encoded at a high
+// one.
+func TestTwoPassConstrainsKeyframeSize(t *testing.T) {
+	const width, height = 32, 32
+	frames := make([][]byte, 6)
+	for i := range frames {
+		frames[i] = noisyFrame(width, height, i)
+	}
+
+	cfg := encoder.DefaultConfig(width, height)
+	cfg.KeyframeInterval = 1
+
+	statsPath := filepath.Join(t.TempDir(), "stats.gob")
+
+	encodeWith := func(mode ratecontrol.Mode, bitrate int) int {
+		var buf bytes.Buffer
+		enc, err := encoder.NewEncoder(&buf, cfg)
+		if err != nil {
+			t.Fatalf("NewEncoder: %v", err)
+		}
+		if err := enc.SetRateControl(mode, bitrate, statsPath); err != nil {
+			t.Fatalf("SetRateControl: %v", err)
+		}
+		for i, frame := range frames {
+			if err := enc.WriteFrame(frame); err != nil {
+				t.Fatalf("WriteFrame(%d): %v", i, err)
+			}
+		}
+		if err := enc.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		return buf.Len()
+	}
+
+	encodeWith(ratecontrol.Pass1, 0)
+
+	low := encodeWith(ratecontrol.Pass2, 20_000)
+	high := encodeWith(ratecontrol.Pass2, 5_000_000)
+
+	if low >= high {
+		t.Fatalf("low-bitrate Pass2 output (%d bytes) should be smaller than high-bitrate output (%d bytes)", low, high)
+	}
+}
+
+// TestPFrameCorrectsKeyframeQuantizationDrift checks per-frame fidelity
+// against the source across a GOP, not just aggregate output size: a
+// keyframe's DCT quantization is lossy by default (DefaultConfig uses
+// Quality 85), so the encoder must predict P-frames against its own lossy
+// reconstruction of the keyframe, not the original source planes, or the
+// decoder's actual reference frame will never match what the encoder
+// predicted against. Encoding the same unchanged, detailed content for a
+// few frames exercises exactly this: each P-frame's residual should
+// correct the keyframe's reconstruction error back toward the source
+// rather than leaving it exactly as large forever.
+func TestPFrameCorrectsKeyframeQuantizationDrift(t *testing.T) {
+	const width, height = 32, 32
+	source := fidelityFrame(width, height)
+
+	var buf bytes.Buffer
+	enc, err := encoder.NewEncoder(&buf, encoder.DefaultConfig(width, height))
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := enc.WriteFrame(source); err != nil {
+			t.Fatalf("WriteFrame(%d): %v", i, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec, _, err := decoder.NewDecoder(&buf)
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+
+	diffs := make([]int, 3)
+	for i := range diffs {
+		got, err := dec.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame(%d): %v", i, err)
+		}
+		diffs[i] = maxAbsDiff(got, source)
+	}
+
+	if diffs[0] == 0 {
+		t.Fatalf("keyframe reconstruction has zero error; this fixture isn't exercising lossy DCT quantization")
+	}
+	for i := 1; i < len(diffs); i++ {
+		if diffs[i] >= diffs[0] {
+			t.Fatalf("P-frame %d reconstruction error (%d) did not improve on the keyframe's (%d): encoder is predicting against the lossless source instead of its own lossy reconstruction, so identical content never corrects drift", i, diffs[i], diffs[0])
+		}
+	}
+}
+
+// fidelityFrame returns a width*height RGB24 frame with moderate,
+// block-varying detail (gray values 96-159) that exercises lossy DCT
+// quantization without ever reaching 0 or 255, so RGB<->YUV clamping can't
+// mask whether a P-frame's residual is actually correcting reconstruction
+// error.
+func fidelityFrame(width, height int) []byte {
+	frame := make([]byte, width*height*3)
+	for i := 0; i < width*height; i++ {
+		x, y := i%width, i/width
+		v := byte(96 + (x*13+y*7)%64)
+		frame[3*i], frame[3*i+1], frame[3*i+2] = v, v, v
+	}
+	return frame
+}
+
+// maxAbsDiff returns the largest absolute per-byte difference between two
+// equal-length byte slices.
+func maxAbsDiff(a, b []byte) int {
+	max := 0
+	for i := range a {
+		d := int(a[i]) - int(b[i])
+		if d < 0 {
+			d = -d
+		}
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
@@ -0,0 +1,84 @@
+package encoder_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/Mvoii/video_codec/decoder"
+	"github.com/Mvoii/video_codec/encoder"
+)
+
+// solidFrame returns a width*height RGB24 frame filled with one color.
+func solidFrame(width, height int, r, g, b byte) []byte {
+	frame := make([]byte, width*height*3)
+	for i := 0; i < width*height; i++ {
+		frame[3*i], frame[3*i+1], frame[3*i+2] = r, g, b
+	}
+	return frame
+}
+
+// approxEqual allows for the rounding error introduced by the RGB<->YUV
+// conversion.
+func approxEqual(t *testing.T, got, want []byte, tolerance int) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("length mismatch: got %d, want %d", len(got), len(want))
+	}
+	for i := range got {
+		diff := int(got[i]) - int(want[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			t.Fatalf("byte %d: got %d, want %d (tolerance %d)", i, got[i], want[i], tolerance)
+		}
+	}
+}
+
+// TestRoundTrip encodes a handful of frames - a keyframe plus several
+// identical and differing P-frames - and decodes them back, confirming the
+// decoder needs nothing beyond what is in the container stream itself.
+func TestRoundTrip(t *testing.T) {
+	const width, height = 32, 32
+
+	frames := [][]byte{
+		solidFrame(width, height, 120, 130, 140),
+		solidFrame(width, height, 120, 130, 140), // identical: zero delta
+		solidFrame(width, height, 60, 180, 90),   // different: non-zero delta
+	}
+
+	var buf bytes.Buffer
+	enc, err := encoder.NewEncoder(&buf, encoder.DefaultConfig(width, height))
+	if err != nil {
+		t.Fatalf("NewEncoder: %v", err)
+	}
+	for i, frame := range frames {
+		if err := enc.WriteFrame(frame); err != nil {
+			t.Fatalf("WriteFrame(%d): %v", i, err)
+		}
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	dec, header, err := decoder.NewDecoder(&buf)
+	if err != nil {
+		t.Fatalf("NewDecoder: %v", err)
+	}
+	if int(header.Width) != width || int(header.Height) != height {
+		t.Fatalf("header dims = %dx%d, want %dx%d", header.Width, header.Height, width, height)
+	}
+
+	for i, want := range frames {
+		got, err := dec.ReadFrame()
+		if err != nil {
+			t.Fatalf("ReadFrame(%d): %v", i, err)
+		}
+		approxEqual(t, got, want, 16)
+	}
+
+	if _, err := dec.ReadFrame(); err != io.EOF {
+		t.Fatalf("final ReadFrame error = %v, want io.EOF", err)
+	}
+}
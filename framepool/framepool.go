@@ -0,0 +1,69 @@
+// Package framepool provides a reusable pool of YUV frame buffers so a
+// streaming encoder can hold a bounded number of frames in memory -
+// typically just the current and previous one - rather than allocating a
+// fresh buffer per frame for the lifetime of the stream.
+package framepool
+
+import "sync"
+
+// FrameProperties describes the buffers a Frame needs for a given stream.
+type FrameProperties struct {
+	Width, Height int
+	// Subsampling is a container.Chroma* id; only 4:2:0 is supported, so U
+	// and V are quarter the size of Y.
+	Subsampling uint8
+}
+
+// Frame owns the Y, U and V plane buffers for one frame. PTS is set by
+// Pool.Get and is informational only - callers are free to ignore it.
+type Frame struct {
+	Y, U, V []byte
+	PTS     int64
+}
+
+// Pool hands out Frames sized for one FrameProperties, reusing buffers
+// returned via Put instead of allocating new ones.
+type Pool struct {
+	props FrameProperties
+
+	mu   sync.Mutex
+	free []*Frame
+}
+
+// New returns a Pool that hands out Frames matching props.
+func New(props FrameProperties) *Pool {
+	return &Pool{props: props}
+}
+
+// Get returns a Frame with Y/U/V sized for the pool's FrameProperties and
+// its PTS set to pts. It reuses a previously Put frame when one is
+// available, and its plane contents are otherwise whatever the last user
+// left behind - callers are expected to overwrite them in full.
+func (p *Pool) Get(pts int64) *Frame {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n := len(p.free); n > 0 {
+		f := p.free[n-1]
+		p.free = p.free[:n-1]
+		f.PTS = pts
+		return f
+	}
+
+	ySize := p.props.Width * p.props.Height
+	cSize := ySize / 4
+	return &Frame{
+		Y:   make([]byte, ySize),
+		U:   make([]byte, cSize),
+		V:   make([]byte, cSize),
+		PTS: pts,
+	}
+}
+
+// Put returns a Frame to the pool once the caller is done referencing it,
+// making its buffers available to a future Get.
+func (p *Pool) Put(f *Frame) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.free = append(p.free, f)
+}
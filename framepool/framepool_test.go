@@ -0,0 +1,41 @@
+package framepool_test
+
+import (
+	"testing"
+
+	"github.com/Mvoii/video_codec/framepool"
+)
+
+func TestGetPutReusesBuffers(t *testing.T) {
+	pool := framepool.New(framepool.FrameProperties{Width: 16, Height: 16})
+
+	f1 := pool.Get(0)
+	y1 := f1.Y
+	pool.Put(f1)
+
+	f2 := pool.Get(1)
+	if &f2.Y[0] != &y1[0] {
+		t.Fatal("Get after Put should reuse the returned frame's Y buffer")
+	}
+	if f2.PTS != 1 {
+		t.Fatalf("PTS = %d, want 1", f2.PTS)
+	}
+}
+
+// BenchmarkPoolGetPut demonstrates that, in steady state, acquiring and
+// releasing a frame allocates nothing - memory use stays constant no
+// matter how many frames a stream has.
+func BenchmarkPoolGetPut(b *testing.B) {
+	pool := framepool.New(framepool.FrameProperties{Width: 384, Height: 224})
+
+	// Warm the pool so the steady-state loop below never has to allocate.
+	warm := pool.Get(0)
+	pool.Put(warm)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f := pool.Get(int64(i))
+		pool.Put(f)
+	}
+}
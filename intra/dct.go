@@ -0,0 +1,92 @@
+package intra
+
+import "math"
+
+// cosTable[k][n] holds cos(pi/8 * (n+0.5) * k), the basis used by both the
+// forward (DCT-II) and inverse (DCT-III) transforms below.
+var cosTable [BlockSize][BlockSize]float64
+
+func init() {
+	for k := 0; k < BlockSize; k++ {
+		for n := 0; n < BlockSize; n++ {
+			cosTable[k][n] = math.Cos(math.Pi / BlockSize * (float64(n) + 0.5) * float64(k))
+		}
+	}
+}
+
+// alpha is the DCT-II/III normalization factor for coefficient k.
+func alpha(k int) float64 {
+	if k == 0 {
+		return math.Sqrt(1.0 / BlockSize)
+	}
+	return math.Sqrt(2.0 / BlockSize)
+}
+
+// forwardDCT applies a separable 2D DCT-II to an 8x8 block: a 1D transform
+// on each row, then a 1D transform on each resulting column.
+func forwardDCT(block [BlockSize][BlockSize]float64) [BlockSize][BlockSize]float64 {
+	var rows [BlockSize][BlockSize]float64
+	for y := 0; y < BlockSize; y++ {
+		rows[y] = dct1D(block[y])
+	}
+
+	var out [BlockSize][BlockSize]float64
+	for x := 0; x < BlockSize; x++ {
+		var col [BlockSize]float64
+		for y := 0; y < BlockSize; y++ {
+			col[y] = rows[y][x]
+		}
+		col = dct1D(col)
+		for y := 0; y < BlockSize; y++ {
+			out[y][x] = col[y]
+		}
+	}
+	return out
+}
+
+// inverseDCT applies the separable inverse (DCT-III) of forwardDCT.
+func inverseDCT(coeffs [BlockSize][BlockSize]float64) [BlockSize][BlockSize]float64 {
+	var cols [BlockSize][BlockSize]float64
+	for x := 0; x < BlockSize; x++ {
+		var col [BlockSize]float64
+		for y := 0; y < BlockSize; y++ {
+			col[y] = coeffs[y][x]
+		}
+		col = idct1D(col)
+		for y := 0; y < BlockSize; y++ {
+			cols[y][x] = col[y]
+		}
+	}
+
+	var out [BlockSize][BlockSize]float64
+	for y := 0; y < BlockSize; y++ {
+		out[y] = idct1D(cols[y])
+	}
+	return out
+}
+
+// dct1D transforms 8 samples into 8 DCT-II coefficients.
+func dct1D(x [BlockSize]float64) [BlockSize]float64 {
+	var out [BlockSize]float64
+	for k := 0; k < BlockSize; k++ {
+		var sum float64
+		for n := 0; n < BlockSize; n++ {
+			sum += x[n] * cosTable[k][n]
+		}
+		out[k] = alpha(k) * sum
+	}
+	return out
+}
+
+// idct1D transforms 8 DCT-II coefficients back into 8 samples (DCT-III).
+func idct1D(x [BlockSize]float64) [BlockSize]float64 {
+	var out [BlockSize]float64
+	for n := 0; n < BlockSize; n++ {
+		var sum float64
+		for k := 0; k < BlockSize; k++ {
+			sum += alpha(k) * x[k] * cosTable[k][n]
+		}
+		out[n] = sum
+	}
+	return out
+}
@@ -0,0 +1,272 @@
+// Package intra compresses a single image plane the way a JPEG keyframe
+// would: split into 8x8 blocks, forward DCT each block, quantize by a
+// JPEG-style matrix scaled to a quality factor, zig-zag scan the
+// coefficients, and run-length encode the result as (zero-run, value)
+// pairs terminated by an end-of-block marker. The decoder reverses every
+// step to reconstruct the plane. The output is still expected to be run
+// through DEFLATE by the caller, same as P-frame residuals are.
+package intra
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// BlockSize is the side length of the square blocks the DCT operates on.
+const BlockSize = 8
+
+// eob marks the end of a block's coefficients in the RLE stream. It is
+// unambiguous because a real zero-run is at most BlockSize*BlockSize-1 (63),
+// well below 0xFF.
+const eob = 0xFF
+
+// QuantMatrix is an 8x8 table of quantization divisors, indexed [row][col]
+// in natural (non-zig-zag) order.
+type QuantMatrix [BlockSize][BlockSize]int
+
+// baseLuma and baseChroma are the standard JPEG quantization matrices at
+// quality 50, the conventional starting point that LumaQuantMatrix and
+// ChromaQuantMatrix scale from.
+var baseLuma = QuantMatrix{
+	{16, 11, 10, 16, 24, 40, 51, 61},
+	{12, 12, 14, 19, 26, 58, 60, 55},
+	{14, 13, 16, 24, 40, 57, 69, 56},
+	{14, 17, 22, 29, 51, 87, 80, 62},
+	{18, 22, 37, 56, 68, 109, 103, 77},
+	{24, 35, 55, 64, 81, 104, 113, 92},
+	{49, 64, 78, 87, 103, 121, 120, 101},
+	{72, 92, 95, 98, 112, 100, 103, 99},
+}
+
+var baseChroma = QuantMatrix{
+	{17, 18, 24, 47, 99, 99, 99, 99},
+	{18, 21, 26, 66, 99, 99, 99, 99},
+	{24, 26, 56, 99, 99, 99, 99, 99},
+	{47, 66, 99, 99, 99, 99, 99, 99},
+	{99, 99, 99, 99, 99, 99, 99, 99},
+	{99, 99, 99, 99, 99, 99, 99, 99},
+	{99, 99, 99, 99, 99, 99, 99, 99},
+	{99, 99, 99, 99, 99, 99, 99, 99},
+}
+
+// LumaQuantMatrix returns the standard JPEG luma quantization matrix
+// scaled for quality, 1 (smallest, lossiest) to 100 (largest, least lossy).
+func LumaQuantMatrix(quality int) QuantMatrix {
+	return scale(baseLuma, quality)
+}
+
+// ChromaQuantMatrix returns the standard JPEG chroma quantization matrix
+// scaled for quality, 1 (smallest, lossiest) to 100 (largest, least lossy).
+func ChromaQuantMatrix(quality int) QuantMatrix {
+	return scale(baseChroma, quality)
+}
+
+// scale applies the standard libjpeg quality scaling formula to base.
+func scale(base QuantMatrix, quality int) QuantMatrix {
+	if quality < 1 {
+		quality = 1
+	}
+	if quality > 100 {
+		quality = 100
+	}
+
+	var factor int
+	if quality < 50 {
+		factor = 5000 / quality
+	} else {
+		factor = 200 - 2*quality
+	}
+
+	var m QuantMatrix
+	for i := 0; i < BlockSize; i++ {
+		for j := 0; j < BlockSize; j++ {
+			v := (base[i][j]*factor + 50) / 100
+			if v < 1 {
+				v = 1
+			}
+			if v > 255 {
+				v = 255
+			}
+			m[i][j] = v
+		}
+	}
+	return m
+}
+
+// ScaleMatrix multiplies every entry of m by factor and clamps the result
+// back into a matrix's valid 1..255 range. Callers use this to adapt a
+// fixed Quality-derived matrix to a per-frame rate control decision
+// without re-deriving it from scratch each time.
+func ScaleMatrix(m QuantMatrix, factor float64) QuantMatrix {
+	var out QuantMatrix
+	for i := 0; i < BlockSize; i++ {
+		for j := 0; j < BlockSize; j++ {
+			v := int(math.Round(float64(m[i][j]) * factor))
+			if v < 1 {
+				v = 1
+			}
+			if v > 255 {
+				v = 255
+			}
+			out[i][j] = v
+		}
+	}
+	return out
+}
+
+// Encode splits plane into BlockSize x BlockSize blocks in raster order,
+// DCT-transforms and quantizes each by q, and returns the zig-zag scanned,
+// run-length encoded coefficient stream.
+func Encode(plane []byte, width, height int, q QuantMatrix) ([]byte, error) {
+	if width%BlockSize != 0 || height%BlockSize != 0 {
+		return nil, fmt.Errorf("intra: dimensions %dx%d must be multiples of %d", width, height, BlockSize)
+	}
+	if len(plane) != width*height {
+		return nil, fmt.Errorf("intra: plane is %d bytes, want %d", len(plane), width*height)
+	}
+
+	var buf bytes.Buffer
+	for by := 0; by < height; by += BlockSize {
+		for bx := 0; bx < width; bx += BlockSize {
+			block := extractBlock(plane, width, bx, by)
+			coeffs := forwardDCT(block)
+			quantized := quantizeBlock(coeffs, q)
+			encodeBlock(&buf, zigZag(quantized))
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// Decode reverses Encode: it walks data block by block, dequantizing and
+// inverse-DCTing each, and reconstructs a width*height plane.
+func Decode(data []byte, width, height int, q QuantMatrix) ([]byte, error) {
+	if width%BlockSize != 0 || height%BlockSize != 0 {
+		return nil, fmt.Errorf("intra: dimensions %dx%d must be multiples of %d", width, height, BlockSize)
+	}
+
+	plane := make([]byte, width*height)
+	r := bytes.NewReader(data)
+	for by := 0; by < height; by += BlockSize {
+		for bx := 0; bx < width; bx += BlockSize {
+			zz, err := decodeBlock(r)
+			if err != nil {
+				return nil, fmt.Errorf("intra: block (%d,%d): %w", bx, by, err)
+			}
+			quantized := unZigZag(zz)
+			coeffs := dequantizeBlock(quantized, q)
+			block := inverseDCT(coeffs)
+			insertBlock(plane, width, bx, by, block)
+		}
+	}
+	return plane, nil
+}
+
+// extractBlock reads an 8x8 block of a plane into a float64 grid, centered
+// around zero the way the DCT expects (byte samples run 0..255).
+func extractBlock(plane []byte, width, bx, by int) [BlockSize][BlockSize]float64 {
+	var block [BlockSize][BlockSize]float64
+	for y := 0; y < BlockSize; y++ {
+		for x := 0; x < BlockSize; x++ {
+			block[y][x] = float64(plane[(by+y)*width+bx+x]) - 128
+		}
+	}
+	return block
+}
+
+// insertBlock writes a reconstructed 8x8 block back into a plane, undoing
+// extractBlock's zero-centering and clamping to a valid byte.
+func insertBlock(plane []byte, width, bx, by int, block [BlockSize][BlockSize]float64) {
+	for y := 0; y < BlockSize; y++ {
+		for x := 0; x < BlockSize; x++ {
+			plane[(by+y)*width+bx+x] = roundByte(block[y][x] + 128)
+		}
+	}
+}
+
+// quantizeBlock divides each DCT coefficient by its quantization matrix
+// entry and rounds to the nearest integer.
+func quantizeBlock(coeffs [BlockSize][BlockSize]float64, q QuantMatrix) [BlockSize][BlockSize]int {
+	var out [BlockSize][BlockSize]int
+	for i := 0; i < BlockSize; i++ {
+		for j := 0; j < BlockSize; j++ {
+			out[i][j] = int(math.Round(coeffs[i][j] / float64(q[i][j])))
+		}
+	}
+	return out
+}
+
+// dequantizeBlock is the inverse of quantizeBlock.
+func dequantizeBlock(q [BlockSize][BlockSize]int, matrix QuantMatrix) [BlockSize][BlockSize]float64 {
+	var out [BlockSize][BlockSize]float64
+	for i := 0; i < BlockSize; i++ {
+		for j := 0; j < BlockSize; j++ {
+			out[i][j] = float64(q[i][j] * matrix[i][j])
+		}
+	}
+	return out
+}
+
+// encodeBlock run-length encodes a zig-zag scanned coefficient sequence as
+// (run-of-zeros byte, nonzero int16 value) pairs, terminated by eob.
+func encodeBlock(buf *bytes.Buffer, zz [BlockSize * BlockSize]int) {
+	run := 0
+	for _, v := range zz {
+		if v == 0 {
+			run++
+			continue
+		}
+		for run > 63 {
+			// A real run can never reach the eob sentinel value, but keep
+			// every emitted run comfortably below it anyway.
+			buf.WriteByte(63)
+			binary.Write(buf, binary.BigEndian, int16(0))
+			run -= 63
+		}
+		buf.WriteByte(byte(run))
+		binary.Write(buf, binary.BigEndian, int16(v))
+		run = 0
+	}
+	buf.WriteByte(eob)
+}
+
+// decodeBlock reverses encodeBlock, reading pairs until eob and returning
+// the reconstructed zig-zag scanned coefficient sequence.
+func decodeBlock(r *bytes.Reader) ([BlockSize * BlockSize]int, error) {
+	var zz [BlockSize * BlockSize]int
+	pos := 0
+	for {
+		run, err := r.ReadByte()
+		if err != nil {
+			return zz, fmt.Errorf("read run: %w", err)
+		}
+		if run == eob {
+			return zz, nil
+		}
+
+		pos += int(run)
+		if pos >= len(zz) {
+			return zz, fmt.Errorf("run overruns block")
+		}
+
+		var v int16
+		if err := binary.Read(r, binary.BigEndian, &v); err != nil {
+			return zz, fmt.Errorf("read value: %w", err)
+		}
+		zz[pos] = int(v)
+		pos++
+	}
+}
+
+// roundByte rounds and clamps a code value into the 0-255 byte range.
+func roundByte(x float64) byte {
+	x = math.Round(x)
+	if x < 0 {
+		return 0
+	}
+	if x > 255 {
+		return 255
+	}
+	return byte(x)
+}
@@ -0,0 +1,83 @@
+package intra_test
+
+import (
+	"testing"
+
+	"github.com/Mvoii/video_codec/intra"
+)
+
+// TestRoundTrip checks that a gently varying plane survives the DCT,
+// quantize, zig-zag and RLE pipeline and back within the loss a high
+// quality factor should allow.
+func TestRoundTrip(t *testing.T) {
+	const width, height = 16, 16
+	plane := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			plane[y*width+x] = byte(100 + x*2 + y)
+		}
+	}
+
+	q := intra.LumaQuantMatrix(90)
+
+	encoded, err := intra.Encode(plane, width, height, q)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := intra.Decode(encoded, width, height, q)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+
+	if len(decoded) != len(plane) {
+		t.Fatalf("decoded length = %d, want %d", len(decoded), len(plane))
+	}
+	for i := range plane {
+		diff := int(decoded[i]) - int(plane[i])
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > 8 {
+			t.Fatalf("byte %d: got %d, want %d (+/-8)", i, decoded[i], plane[i])
+		}
+	}
+}
+
+// TestSolidBlockIsLossless checks the degenerate all-DC case: a flat block
+// should survive exactly, since only the DC coefficient is nonzero and
+// quantization error there is at most rounding to the nearest quantum.
+func TestSolidBlockIsLossless(t *testing.T) {
+	const width, height = 8, 8
+	plane := make([]byte, width*height)
+	for i := range plane {
+		plane[i] = 128
+	}
+
+	q := intra.LumaQuantMatrix(100)
+	encoded, err := intra.Encode(plane, width, height, q)
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	decoded, err := intra.Decode(encoded, width, height, q)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	for i := range plane {
+		if decoded[i] != plane[i] {
+			t.Fatalf("byte %d: got %d, want %d", i, decoded[i], plane[i])
+		}
+	}
+}
+
+func TestQuantMatrixRange(t *testing.T) {
+	for _, q := range []int{-10, 1, 50, 90, 100, 500} {
+		m := intra.LumaQuantMatrix(q)
+		for i := 0; i < intra.BlockSize; i++ {
+			for j := 0; j < intra.BlockSize; j++ {
+				if m[i][j] < 1 || m[i][j] > 255 {
+					t.Fatalf("quality %d: matrix[%d][%d] = %d, out of 1..255", q, i, j, m[i][j])
+				}
+			}
+		}
+	}
+}
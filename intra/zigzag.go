@@ -0,0 +1,35 @@
+package intra
+
+// zigZagOrder lists, for each position in the zig-zag scanned sequence,
+// the (row, col) it comes from in an 8x8 block - the standard JPEG scan
+// order, which visits low frequencies (top-left) first so zero runs
+// cluster towards the end of the sequence.
+var zigZagOrder = [BlockSize * BlockSize][2]int{
+	{0, 0}, {0, 1}, {1, 0}, {2, 0}, {1, 1}, {0, 2}, {0, 3}, {1, 2},
+	{2, 1}, {3, 0}, {4, 0}, {3, 1}, {2, 2}, {1, 3}, {0, 4}, {0, 5},
+	{1, 4}, {2, 3}, {3, 2}, {4, 1}, {5, 0}, {6, 0}, {5, 1}, {4, 2},
+	{3, 3}, {2, 4}, {1, 5}, {0, 6}, {0, 7}, {1, 6}, {2, 5}, {3, 4},
+	{4, 3}, {5, 2}, {6, 1}, {7, 0}, {7, 1}, {6, 2}, {5, 3}, {4, 4},
+	{3, 5}, {2, 6}, {1, 7}, {2, 7}, {3, 6}, {4, 5}, {5, 4}, {6, 3},
+	{7, 2}, {7, 3}, {6, 4}, {5, 5}, {4, 6}, {3, 7}, {4, 7}, {5, 6},
+	{6, 5}, {7, 4}, {7, 5}, {6, 6}, {5, 7}, {6, 7}, {7, 6}, {7, 7},
+}
+
+// zigZag flattens an 8x8 block into a 64-element sequence in zig-zag
+// order.
+func zigZag(block [BlockSize][BlockSize]int) [BlockSize * BlockSize]int {
+	var out [BlockSize * BlockSize]int
+	for i, rc := range zigZagOrder {
+		out[i] = block[rc[0]][rc[1]]
+	}
+	return out
+}
+
+// unZigZag reverses zigZag.
+func unZigZag(seq [BlockSize * BlockSize]int) [BlockSize][BlockSize]int {
+	var block [BlockSize][BlockSize]int
+	for i, rc := range zigZagOrder {
+		block[rc[0]][rc[1]] = seq[i]
+	}
+	return block
+}
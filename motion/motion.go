@@ -0,0 +1,205 @@
+// Package motion implements block-based motion estimation and
+// compensation for inter-predicted (P) frames, in the style of the
+// macroblock search used by codecs like VP8. The Y plane of a frame is
+// partitioned into fixed-size macroblocks; for each block, a search over a
+// window of the previous frame finds the offset that best predicts it, and
+// callers use that offset to build predicted planes and residuals.
+package motion
+
+// BlockSize is the macroblock edge length, in luma samples. Callers are
+// expected to only pass frames whose width and height are multiples of
+// BlockSize, so every macroblock is full-sized.
+const BlockSize = 16
+
+// SearchRange is the maximum pixel displacement, in either axis, searched
+// in the reference frame.
+const SearchRange = 16
+
+// MV is a motion vector: the displacement, in pixels, from a macroblock's
+// position in the current frame to its best-matching position in the
+// reference frame.
+type MV struct {
+	DX, DY int8
+}
+
+// grid returns the macroblock column/row counts for a width x height
+// plane.
+func grid(width, height int) (cols, rows int) {
+	return width / BlockSize, height / BlockSize
+}
+
+// EstimateFull computes one motion vector per macroblock by exhaustively
+// searching every candidate displacement in [-SearchRange, SearchRange]
+// and keeping the one that minimizes SAD (sum of absolute differences)
+// against prev. It is the reference implementation used to sanity-check
+// EstimateDiamond.
+func EstimateFull(cur, prev []byte, width, height int) []MV {
+	cols, rows := grid(width, height)
+	mvs := make([]MV, cols*rows)
+
+	for by := 0; by < rows; by++ {
+		for bx := 0; bx < cols; bx++ {
+			x0, y0 := bx*BlockSize, by*BlockSize
+			bestDX, bestDY := 0, 0
+			bestSAD := sad(cur, prev, width, height, x0, y0, x0, y0)
+
+			for dy := -SearchRange; dy <= SearchRange; dy++ {
+				for dx := -SearchRange; dx <= SearchRange; dx++ {
+					if dx == 0 && dy == 0 {
+						continue
+					}
+					if !inBounds(x0+dx, y0+dy, width, height) {
+						continue
+					}
+					s := sad(cur, prev, width, height, x0, y0, x0+dx, y0+dy)
+					if s < bestSAD {
+						bestSAD, bestDX, bestDY = s, dx, dy
+					}
+				}
+			}
+
+			mvs[by*cols+bx] = MV{DX: int8(bestDX), DY: int8(bestDY)}
+		}
+	}
+	return mvs
+}
+
+// EstimateDiamond computes motion vectors the same way as EstimateFull but
+// using a large-diamond-then-small-diamond search pattern instead of
+// exhaustively scanning every candidate. It visits far fewer positions and
+// is the path the encoder uses by default; EstimateFull exists to verify
+// it isn't leaving significant compression on the table.
+func EstimateDiamond(cur, prev []byte, width, height int) []MV {
+	cols, rows := grid(width, height)
+	mvs := make([]MV, cols*rows)
+
+	large := [][2]int{{0, -2}, {0, 2}, {-2, 0}, {2, 0}, {-2, -2}, {2, -2}, {-2, 2}, {2, 2}}
+	small := [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+
+	for by := 0; by < rows; by++ {
+		for bx := 0; bx < cols; bx++ {
+			x0, y0 := bx*BlockSize, by*BlockSize
+
+			bestDX, bestDY := 0, 0
+			bestSAD := sad(cur, prev, width, height, x0, y0, x0, y0)
+
+			// Large diamond search pattern: repeatedly step toward the
+			// best neighbor until the center itself is the best candidate.
+			for {
+				improved := false
+				for _, d := range large {
+					dx, dy := bestDX+d[0], bestDY+d[1]
+					if dx < -SearchRange || dx > SearchRange || dy < -SearchRange || dy > SearchRange {
+						continue
+					}
+					if !inBounds(x0+dx, y0+dy, width, height) {
+						continue
+					}
+					s := sad(cur, prev, width, height, x0, y0, x0+dx, y0+dy)
+					if s < bestSAD {
+						bestSAD, bestDX, bestDY = s, dx, dy
+						improved = true
+					}
+				}
+				if !improved {
+					break
+				}
+			}
+
+			// Small diamond refinement around the large-search result.
+			for _, d := range small {
+				dx, dy := bestDX+d[0], bestDY+d[1]
+				if dx < -SearchRange || dx > SearchRange || dy < -SearchRange || dy > SearchRange {
+					continue
+				}
+				if !inBounds(x0+dx, y0+dy, width, height) {
+					continue
+				}
+				s := sad(cur, prev, width, height, x0, y0, x0+dx, y0+dy)
+				if s < bestSAD {
+					bestSAD, bestDX, bestDY = s, dx, dy
+				}
+			}
+
+			mvs[by*cols+bx] = MV{DX: int8(bestDX), DY: int8(bestDY)}
+		}
+	}
+	return mvs
+}
+
+// Predict reconstructs a full plane by copying, for each macroblock, the
+// block from prev at the position given by its motion vector (scaled down
+// by div, so chroma planes can reuse the luma motion field with the
+// vectors halved). width and height are of prev/the output plane, not of
+// the motion vector grid.
+func Predict(prev []byte, width, height, blockSize, div int, mvs []MV) []byte {
+	cols := width / blockSize
+	out := make([]byte, width*height)
+
+	for idx, mv := range mvs {
+		bx, by := idx%cols, idx/cols
+		dx, dy := int(mv.DX)/div, int(mv.DY)/div
+		x0, y0 := bx*blockSize, by*blockSize
+
+		for y := 0; y < blockSize; y++ {
+			sy := clamp(y0+y+dy, 0, height-1)
+			for x := 0; x < blockSize; x++ {
+				sx := clamp(x0+x+dx, 0, width-1)
+				out[(y0+y)*width+(x0+x)] = prev[sy*width+sx]
+			}
+		}
+	}
+	return out
+}
+
+// Residual returns cur - predicted, byte-wise, wrapping like the delta
+// frames used elsewhere in the codec.
+func Residual(cur, predicted []byte) []byte {
+	out := make([]byte, len(cur))
+	for i := range out {
+		out[i] = cur[i] - predicted[i]
+	}
+	return out
+}
+
+// Reconstruct returns predicted + residual, byte-wise - the inverse of
+// Residual.
+func Reconstruct(predicted, residual []byte) []byte {
+	out := make([]byte, len(predicted))
+	for i := range out {
+		out[i] = predicted[i] + residual[i]
+	}
+	return out
+}
+
+func sad(cur, prev []byte, width, height, curX, curY, refX, refY int) int {
+	total := 0
+	for y := 0; y < BlockSize; y++ {
+		curRow := (curY + y) * width
+		refRow := (refY + y) * width
+		for x := 0; x < BlockSize; x++ {
+			c := int(cur[curRow+curX+x])
+			p := int(prev[refRow+refX+x])
+			d := c - p
+			if d < 0 {
+				d = -d
+			}
+			total += d
+		}
+	}
+	return total
+}
+
+func inBounds(x, y, width, height int) bool {
+	return x >= 0 && y >= 0 && x+BlockSize <= width && y+BlockSize <= height
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
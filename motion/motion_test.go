@@ -0,0 +1,105 @@
+package motion_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/Mvoii/video_codec/motion"
+)
+
+// shiftedFrame returns prev shifted by (dx, dy), clamping at the edges.
+func shiftedFrame(prev []byte, width, height, dx, dy int) []byte {
+	out := make([]byte, len(prev))
+	for y := 0; y < height; y++ {
+		sy := y + dy
+		if sy < 0 {
+			sy = 0
+		}
+		if sy >= height {
+			sy = height - 1
+		}
+		for x := 0; x < width; x++ {
+			sx := x + dx
+			if sx < 0 {
+				sx = 0
+			}
+			if sx >= width {
+				sx = width - 1
+			}
+			out[y*width+x] = prev[sy*width+sx]
+		}
+	}
+	return out
+}
+
+func sumAbs(data []byte) int {
+	total := 0
+	for _, b := range data {
+		d := int(int8(b))
+		if d < 0 {
+			d = -d
+		}
+		total += d
+	}
+	return total
+}
+
+// TestEstimateFullBeatsZeroMotion checks that motion compensation against a
+// uniformly shifted frame produces far less residual energy than a naive
+// zero-motion (direct) delta would.
+func TestEstimateFullBeatsZeroMotion(t *testing.T) {
+	const width, height = 64, 64
+	r := rand.New(rand.NewSource(1))
+
+	prev := make([]byte, width*height)
+	for i := range prev {
+		prev[i] = byte(r.Intn(256))
+	}
+	cur := shiftedFrame(prev, width, height, 3, -2)
+
+	zeroMotionResidual := motion.Residual(cur, prev)
+
+	mvs := motion.EstimateFull(cur, prev, width, height)
+	predicted := motion.Predict(prev, width, height, motion.BlockSize, 1, mvs)
+	compensatedResidual := motion.Residual(cur, predicted)
+
+	if got, want := sumAbs(compensatedResidual), sumAbs(zeroMotionResidual); got >= want {
+		t.Fatalf("motion-compensated residual energy %d did not beat zero-motion %d", got, want)
+	}
+
+	// The macroblock starting at (16, 16) is entirely unaffected by edge
+	// clamping, so EstimateFull should recover the true shift there exactly.
+	for y := 16; y < 16+motion.BlockSize; y++ {
+		for x := 16; x < 16+motion.BlockSize; x++ {
+			i := y*width + x
+			if compensatedResidual[i] != 0 {
+				t.Fatalf("pixel (%d,%d): expected zero residual in an interior block, got %d", x, y, compensatedResidual[i])
+			}
+		}
+	}
+}
+
+// TestEstimateDiamondReconstructs verifies Predict/Residual/Reconstruct
+// round-trip exactly regardless of which motion vectors are chosen, using
+// the faster diamond search.
+func TestEstimateDiamondReconstructs(t *testing.T) {
+	const width, height = 32, 32
+	r := rand.New(rand.NewSource(2))
+
+	prev := make([]byte, width*height)
+	for i := range prev {
+		prev[i] = byte(r.Intn(256))
+	}
+	cur := shiftedFrame(prev, width, height, -4, 4)
+
+	mvs := motion.EstimateDiamond(cur, prev, width, height)
+	predicted := motion.Predict(prev, width, height, motion.BlockSize, 1, mvs)
+	residual := motion.Residual(cur, predicted)
+	reconstructed := motion.Reconstruct(predicted, residual)
+
+	for i := range reconstructed {
+		if reconstructed[i] != cur[i] {
+			t.Fatalf("byte %d: reconstructed %d, want %d", i, reconstructed[i], cur[i])
+		}
+	}
+}
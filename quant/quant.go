@@ -0,0 +1,37 @@
+// Package quant implements the uniform scalar quantizer applied to
+// motion-compensated residuals so rate control has a quality knob to turn:
+// a larger quantizer step throws away more detail in exchange for fewer
+// bits to encode.
+package quant
+
+// Quantize divides each (signed) residual byte by q. Integer division
+// truncates toward zero, which gives the quantizer a dead-zone around 0
+// for free: any residual smaller than q collapses to exactly zero.
+func Quantize(residual []byte, q int) []byte {
+	if q <= 1 {
+		return residual
+	}
+
+	out := make([]byte, len(residual))
+	for i, b := range residual {
+		v := int(int8(b))
+		out[i] = byte(int8(v / q))
+	}
+	return out
+}
+
+// Dequantize reverses Quantize by scaling back up by q. This only
+// recovers the original value modulo the precision lost in Quantize's
+// truncating division.
+func Dequantize(quantized []byte, q int) []byte {
+	if q <= 1 {
+		return quantized
+	}
+
+	out := make([]byte, len(quantized))
+	for i, b := range quantized {
+		v := int(int8(b))
+		out[i] = byte(int8(v * q))
+	}
+	return out
+}
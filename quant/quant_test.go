@@ -0,0 +1,31 @@
+package quant_test
+
+import (
+	"testing"
+
+	"github.com/Mvoii/video_codec/quant"
+)
+
+func asByte(v int8) byte { return byte(v) }
+
+func TestQuantizeDeadZone(t *testing.T) {
+	residual := []byte{asByte(0), asByte(3), asByte(-3), asByte(10), asByte(-10)}
+	got := quant.Quantize(residual, 8)
+
+	want := []int8{0, 0, 0, 1, -1}
+	for i, b := range got {
+		if int8(b) != want[i] {
+			t.Fatalf("byte %d: got %d, want %d", i, int8(b), want[i])
+		}
+	}
+}
+
+func TestQuantizeDequantizeIdentityAtQ1(t *testing.T) {
+	residual := []byte{0, 1, 255, 128, 42}
+	if got := quant.Quantize(residual, 1); string(got) != string(residual) {
+		t.Fatalf("Quantize with q=1 should be a no-op, got %v want %v", got, residual)
+	}
+	if got := quant.Dequantize(residual, 1); string(got) != string(residual) {
+		t.Fatalf("Dequantize with q=1 should be a no-op, got %v want %v", got, residual)
+	}
+}
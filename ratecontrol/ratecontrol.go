@@ -0,0 +1,264 @@
+// Package ratecontrol implements a two-pass bitrate controller, loosely
+// inspired by the per-subtype complexity model in rav1e's rate.rs: a first
+// pass encodes at a fixed reference quantizer and records, per frame, how
+// much that frame "cost" in bits; a second pass replays those costs to
+// pick a per-frame quantizer that keeps output near a target bitrate.
+package ratecontrol
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Mode selects how a Controller behaves.
+type Mode int
+
+const (
+	// None disables rate control: frames are always quantized at RefQuantizer.
+	None Mode = iota
+	// Pass1 encodes at RefQuantizer and records per-frame stats to disk.
+	Pass1
+	// Pass2 reads stats written by a prior Pass1 run and adapts the
+	// quantizer to hit TargetBitrate.
+	Pass2
+)
+
+// Frame subtypes, tracked separately because keyframes and P-frames have
+// very different bit costs for the same visual complexity.
+const (
+	SubtypeI byte = iota
+	SubtypeP
+)
+
+// RefQuantizer is the fixed quantizer used for P-frames during Pass1 and
+// whenever rate control is off.
+const RefQuantizer = 4
+
+// QMax is the largest quantizer Quantizer will ever return.
+const QMax = 127
+
+// reservoirWindow is, approximately, how many frames of leak history the
+// VBV-like reservoir looks back over.
+const reservoirWindow = 30
+
+// Record is one frame's stats, as logged by Pass1 and replayed by Pass2.
+type Record struct {
+	Subtype       byte
+	LogComplexity float64 // log2(bits * quantizer used to produce them)
+	Bits          int
+}
+
+// Controller drives the quantizer an Encoder uses for each frame.
+type Controller struct {
+	mode Mode
+
+	// Pass1 state.
+	statsFile *os.File
+	enc       *gob.Encoder
+
+	// Pass2 state.
+	iRecords  []Record
+	pRecords  []Record
+	iIdx      int
+	pIdx      int
+	reservoir *reservoir
+}
+
+// New creates a Controller for the given mode. bitrate is the target
+// bitrate in bits per second (only used in Pass2); framerateNum/Den give
+// the stream's framerate, used to convert that into a per-frame bit
+// budget; statsPath is where Pass1 writes stats and Pass2 reads them from.
+func New(mode Mode, bitrate, framerateNum, framerateDen int, statsPath string) (*Controller, error) {
+	c := &Controller{mode: mode}
+
+	switch mode {
+	case None:
+		// Nothing to set up.
+	case Pass1:
+		f, err := os.Create(statsPath)
+		if err != nil {
+			return nil, fmt.Errorf("ratecontrol: create stats file: %w", err)
+		}
+		c.statsFile = f
+		c.enc = gob.NewEncoder(f)
+	case Pass2:
+		records, err := readStats(statsPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range records {
+			if r.Subtype == SubtypeI {
+				c.iRecords = append(c.iRecords, r)
+			} else {
+				c.pRecords = append(c.pRecords, r)
+			}
+		}
+		if bitrate <= 0 || framerateNum <= 0 || framerateDen <= 0 {
+			return nil, fmt.Errorf("ratecontrol: invalid bitrate/framerate for Pass2")
+		}
+		bitsPerFrame := float64(bitrate) * float64(framerateDen) / float64(framerateNum)
+		c.reservoir = newReservoir(bitsPerFrame, reservoirWindow)
+	default:
+		return nil, fmt.Errorf("ratecontrol: unknown mode %d", mode)
+	}
+
+	return c, nil
+}
+
+// Quantizer returns the quantizer to use for the next frame of the given
+// subtype. With rate control off (a nil Controller, or Mode None),
+// P-frames are encoded losslessly (quantizer 1); keyframes get
+// RefQuantizer, which callers are expected to treat as "no scaling
+// applied" - i.e. the quantization implied by Config.Quality alone.
+// Pass1 always uses RefQuantizer for both subtypes so its stats are
+// comparable across frames; Pass2 adapts each subtype independently to
+// hit the target bitrate.
+func (c *Controller) Quantizer(subtype byte) int {
+	if c == nil || c.mode == None {
+		if subtype == SubtypeI {
+			return RefQuantizer
+		}
+		return 1
+	}
+	if c.mode == Pass1 {
+		return RefQuantizer
+	}
+
+	var rec Record
+	switch subtype {
+	case SubtypeI:
+		if c.iIdx >= len(c.iRecords) {
+			return RefQuantizer
+		}
+		rec = c.iRecords[c.iIdx]
+	default:
+		if c.pIdx >= len(c.pRecords) {
+			return RefQuantizer
+		}
+		rec = c.pRecords[c.pIdx]
+	}
+
+	complexity := math.Exp2(rec.LogComplexity)
+	budget := c.reservoir.frameBudget()
+	if budget < 1 {
+		budget = 1
+	}
+
+	q := int(math.Round(complexity / budget))
+	if q < 1 {
+		q = 1
+	}
+	if q > QMax {
+		q = QMax
+	}
+	return q
+}
+
+// Observe records the outcome of encoding a frame: Pass1 appends a stats
+// record, Pass2 feeds the reservoir and advances to the next stats record.
+func (c *Controller) Observe(subtype byte, q, bits int) error {
+	if c == nil {
+		return nil
+	}
+
+	switch c.mode {
+	case Pass1:
+		rec := Record{
+			Subtype:       subtype,
+			LogComplexity: math.Log2(float64(bits) * float64(q)),
+			Bits:          bits,
+		}
+		return c.enc.Encode(&rec)
+	case Pass2:
+		if subtype == SubtypeI {
+			c.iIdx++
+		} else {
+			c.pIdx++
+		}
+		c.reservoir.update(bits)
+	}
+	return nil
+}
+
+// Close flushes any Pass1 stats file. It is a no-op in other modes.
+func (c *Controller) Close() error {
+	if c == nil || c.statsFile == nil {
+		return nil
+	}
+	return c.statsFile.Close()
+}
+
+func readStats(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("ratecontrol: open stats file: %w", err)
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+	var records []Record
+	for {
+		var rec Record
+		if err := dec.Decode(&rec); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("ratecontrol: decode stats record: %w", err)
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// reservoir is a small leaky-bucket model: it tracks how many bits the
+// last len(window) frames actually spent against the target, and nudges
+// the next frame's budget to pull that trailing average back toward the
+// target - the same idea as a decoder-side VBV buffer, run in reverse at
+// encode time. Bounding it to a trailing window (rather than an
+// all-time running total) means a burst of complexity 1000 frames ago
+// has leaked away and no longer biases today's budget.
+type reservoir struct {
+	target float64 // bits/frame we're aiming for on average
+
+	window []int // ring buffer of the last len(window) frames' actual bits
+	pos    int
+	filled int // how many of window's slots hold real data so far
+}
+
+func newReservoir(targetBitsPerFrame float64, windowFrames int) *reservoir {
+	return &reservoir{
+		target: targetBitsPerFrame,
+		window: make([]int, windowFrames),
+	}
+}
+
+// frameBudget returns the bit budget for the next frame: the target,
+// reduced when the trailing window has been running over and increased
+// when it has been running under, damped so a single frame can't swing
+// wildly.
+func (r *reservoir) frameBudget() float64 {
+	const damping = 0.5
+	if r.filled == 0 {
+		return r.target
+	}
+
+	var sum int
+	for i := 0; i < r.filled; i++ {
+		sum += r.window[i]
+	}
+	avgSpend := float64(sum) / float64(r.filled)
+
+	return r.target - damping*(avgSpend-r.target)
+}
+
+func (r *reservoir) update(actualBits int) {
+	r.window[r.pos] = actualBits
+	r.pos = (r.pos + 1) % len(r.window)
+	if r.filled < len(r.window) {
+		r.filled++
+	}
+}
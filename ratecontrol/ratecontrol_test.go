@@ -0,0 +1,55 @@
+package ratecontrol_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Mvoii/video_codec/ratecontrol"
+)
+
+func TestTwoPassRoundTrip(t *testing.T) {
+	statsPath := filepath.Join(t.TempDir(), "stats.gob")
+
+	pass1, err := ratecontrol.New(ratecontrol.Pass1, 0, 25, 1, statsPath)
+	if err != nil {
+		t.Fatalf("New(Pass1): %v", err)
+	}
+	if err := pass1.Observe(ratecontrol.SubtypeI, 1, 40000); err != nil {
+		t.Fatalf("Observe(I): %v", err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := pass1.Observe(ratecontrol.SubtypeP, ratecontrol.RefQuantizer, 8000); err != nil {
+			t.Fatalf("Observe(P, %d): %v", i, err)
+		}
+	}
+	if err := pass1.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// A low target bitrate should push the Pass2 quantizer above the
+	// Pass1 reference; a high one should keep it at or near 1.
+	low, err := ratecontrol.New(ratecontrol.Pass2, 20_000, 25, 1, statsPath)
+	if err != nil {
+		t.Fatalf("New(Pass2, low): %v", err)
+	}
+	low.Quantizer(ratecontrol.SubtypeI) // consume the I record
+	if q := low.Quantizer(ratecontrol.SubtypeP); q <= ratecontrol.RefQuantizer {
+		t.Errorf("low-bitrate target: quantizer = %d, want > %d", q, ratecontrol.RefQuantizer)
+	}
+
+	high, err := ratecontrol.New(ratecontrol.Pass2, 5_000_000, 25, 1, statsPath)
+	if err != nil {
+		t.Fatalf("New(Pass2, high): %v", err)
+	}
+	high.Quantizer(ratecontrol.SubtypeI)
+	if q := high.Quantizer(ratecontrol.SubtypeP); q > ratecontrol.RefQuantizer {
+		t.Errorf("high-bitrate target: quantizer = %d, want <= %d", q, ratecontrol.RefQuantizer)
+	}
+}
+
+func TestQuantizerWithoutRateControl(t *testing.T) {
+	var c *ratecontrol.Controller
+	if q := c.Quantizer(ratecontrol.SubtypeP); q != 1 {
+		t.Fatalf("nil controller: Quantizer = %d, want 1 (lossless)", q)
+	}
+}
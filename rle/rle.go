@@ -0,0 +1,40 @@
+// Package rle implements the simple byte-oriented run-length encoding used
+// to pre-condition delta frames before they are handed to DEFLATE. Deltas
+// between successive video frames tend to be mostly zero, so collapsing
+// runs first gives the general-purpose compressor much less work to do.
+package rle
+
+import "fmt"
+
+// Encode returns the run-length encoding of data as a sequence of
+// (count, value) byte pairs, e.g. the run 0,0,0,0,1,1,1,1,1,1 becomes
+// 4,0,6,1. Runs longer than 255 bytes are split across multiple pairs.
+func Encode(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); {
+		var count byte
+		for count = 0; count < 255 && i+int(count) < len(data) && data[i+int(count)] == data[i]; count++ {
+		}
+
+		out = append(out, count, data[i])
+		i += int(count)
+	}
+	return out
+}
+
+// Decode reverses Encode, expanding (count, value) pairs back into the
+// original byte sequence.
+func Decode(data []byte) ([]byte, error) {
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("rle: malformed stream: odd length %d", len(data))
+	}
+
+	out := make([]byte, 0, len(data))
+	for i := 0; i < len(data); i += 2 {
+		count, value := data[i], data[i+1]
+		for j := byte(0); j < count; j++ {
+			out = append(out, value)
+		}
+	}
+	return out, nil
+}